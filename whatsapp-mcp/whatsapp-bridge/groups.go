@@ -0,0 +1,427 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// GroupParticipant mirrors a row of the group_participants table.
+type GroupParticipant struct {
+	JID          string
+	IsAdmin      bool
+	IsSuperAdmin bool
+}
+
+// StoreGroupParticipants replaces the known participant list for a group chat.
+func (store *MessageStore) StoreGroupParticipants(chatJID string, participants []types.GroupParticipant) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM group_participants WHERE chat_jid = ?", chatJID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, p := range participants {
+		if _, err := tx.Exec(
+			"INSERT INTO group_participants (chat_jid, participant_jid, is_admin, is_superadmin) VALUES (?, ?, ?, ?)",
+			chatJID, p.JID.String(), p.IsAdmin, p.IsSuperAdmin,
+		); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ApplyGroupParticipantDelta applies the joins/leaves/promotions/demotions carried by a single
+// events.GroupInfo to chatJID's roster. events.GroupInfo only ever reports the JIDs that changed,
+// not a full snapshot, so unlike StoreGroupParticipants this never touches rows outside those
+// slices and never resets an untouched member's admin flag.
+func (store *MessageStore) ApplyGroupParticipantDelta(chatJID string, join, leave, promote, demote []types.JID) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, jid := range join {
+		if _, err := tx.Exec(
+			"INSERT OR IGNORE INTO group_participants (chat_jid, participant_jid, is_admin, is_superadmin) VALUES (?, ?, 0, 0)",
+			chatJID, jid.String(),
+		); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, jid := range leave {
+		if _, err := tx.Exec(
+			"DELETE FROM group_participants WHERE chat_jid = ? AND participant_jid = ?",
+			chatJID, jid.String(),
+		); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, jid := range promote {
+		if _, err := tx.Exec(
+			"UPDATE group_participants SET is_admin = 1 WHERE chat_jid = ? AND participant_jid = ?",
+			chatJID, jid.String(),
+		); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, jid := range demote {
+		if _, err := tx.Exec(
+			"UPDATE group_participants SET is_admin = 0 WHERE chat_jid = ? AND participant_jid = ?",
+			chatJID, jid.String(),
+		); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetGroupParticipants returns the stored participant list for a group chat.
+func (store *MessageStore) GetGroupParticipants(chatJID string) ([]GroupParticipant, error) {
+	rows, err := store.db.Query(
+		"SELECT participant_jid, is_admin, is_superadmin FROM group_participants WHERE chat_jid = ?",
+		chatJID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var participants []GroupParticipant
+	for rows.Next() {
+		var p GroupParticipant
+		if err := rows.Scan(&p.JID, &p.IsAdmin, &p.IsSuperAdmin); err != nil {
+			return nil, err
+		}
+		participants = append(participants, p)
+	}
+
+	return participants, nil
+}
+
+// JoinGroupViaLink joins a group using an "https://chat.whatsapp.com/..." invite link or its code.
+func JoinGroupViaLink(client *whatsmeow.Client, link string) (types.JID, error) {
+	code := link
+	if idx := strings.LastIndex(link, "/"); idx >= 0 {
+		code = link[idx+1:]
+	}
+	return client.JoinGroupWithLink(code)
+}
+
+// CreateGroup creates a new group with the given name and participant phone numbers/JIDs.
+func CreateGroup(client *whatsmeow.Client, name string, participants []string) (*types.GroupInfo, error) {
+	jids := make([]types.JID, 0, len(participants))
+	for _, p := range participants {
+		jid, err := parseParticipantJID(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid participant %q: %v", p, err)
+		}
+		jids = append(jids, jid)
+	}
+
+	return client.CreateGroup(whatsmeow.ReqCreateGroup{
+		Name:         name,
+		Participants: jids,
+	})
+}
+
+// LeaveGroup removes the logged-in user from a group.
+func LeaveGroup(client *whatsmeow.Client, groupJID types.JID) error {
+	return client.LeaveGroup(groupJID)
+}
+
+// GetGroupInviteLink returns the current (or newly reset) invite link for a group.
+func GetGroupInviteLink(client *whatsmeow.Client, groupJID types.JID, reset bool) (string, error) {
+	return client.GetGroupInviteLink(groupJID, reset)
+}
+
+// UpdateGroupParticipants adds, removes, promotes, or demotes participants in a group.
+func UpdateGroupParticipants(client *whatsmeow.Client, groupJID types.JID, participants []string, action whatsmeow.ParticipantChange) ([]types.GroupParticipant, error) {
+	jids := make([]types.JID, 0, len(participants))
+	for _, p := range participants {
+		jid, err := parseParticipantJID(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid participant %q: %v", p, err)
+		}
+		jids = append(jids, jid)
+	}
+
+	return client.UpdateGroupParticipants(groupJID, jids, action)
+}
+
+// SetGroupName renames a group.
+func SetGroupName(client *whatsmeow.Client, groupJID types.JID, name string) error {
+	return client.SetGroupName(groupJID, name)
+}
+
+// SetGroupTopic sets a group's description/topic.
+func SetGroupTopic(client *whatsmeow.Client, groupJID types.JID, topic string) error {
+	return client.SetGroupTopic(groupJID, "", "", topic)
+}
+
+// parseParticipantJID accepts either a bare phone number or a full JID string.
+func parseParticipantJID(participant string) (types.JID, error) {
+	if strings.Contains(participant, "@") {
+		return types.ParseJID(participant)
+	}
+	return types.JID{User: participant, Server: "s.whatsapp.net"}, nil
+}
+
+// handleGroupInfo keeps the group_participants table in sync whenever WhatsApp tells us a
+// group's membership changed. events.GroupInfo only carries the JIDs that joined, left, were
+// promoted, or were demoted in this one update, so it's applied as a targeted delta rather than
+// treated as the full roster.
+func handleGroupInfo(messageStore *MessageStore, evt *events.GroupInfo, logger waLog.Logger) {
+	if len(evt.Join) == 0 && len(evt.Leave) == 0 && len(evt.Promote) == 0 && len(evt.Demote) == 0 {
+		return
+	}
+
+	chatJID := evt.JID.String()
+	if err := messageStore.ApplyGroupParticipantDelta(chatJID, evt.Join, evt.Leave, evt.Promote, evt.Demote); err != nil {
+		logger.Warnf("Failed to update group participants for %s: %v", chatJID, err)
+	}
+}
+
+// handleJoinedGroup populates the participant table for a group right after we join it.
+func handleJoinedGroup(client *whatsmeow.Client, messageStore *MessageStore, evt *events.JoinedGroup, logger waLog.Logger) {
+	chatJID := evt.JID.String()
+	if err := messageStore.StoreGroupParticipants(chatJID, evt.Participants); err != nil {
+		logger.Warnf("Failed to store participants for newly joined group %s: %v", chatJID, err)
+	}
+}
+
+// GroupActionResponse is the response body for the group management endpoints.
+type GroupActionResponse struct {
+	Success bool        `json:"success"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// registerGroupHandlers wires up the /api/groups* endpoints onto the default mux.
+func registerGroupHandlers(client *whatsmeow.Client, messageStore *MessageStore, logger waLog.Logger) {
+	http.HandleFunc("/api/groups", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.Method {
+		case http.MethodGet:
+			groups, err := client.GetJoinedGroups()
+			if err != nil {
+				writeGroupError(w, http.StatusInternalServerError, err)
+				return
+			}
+			json.NewEncoder(w).Encode(GroupActionResponse{Success: true, Data: groups})
+
+		case http.MethodPost:
+			var req struct {
+				Name         string   `json:"name"`
+				Participants []string `json:"participants"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request format", http.StatusBadRequest)
+				return
+			}
+			group, err := CreateGroup(client, req.Name, req.Participants)
+			if err != nil {
+				writeGroupError(w, http.StatusInternalServerError, err)
+				return
+			}
+			json.NewEncoder(w).Encode(GroupActionResponse{Success: true, Message: "Group created", Data: group})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	http.HandleFunc("/api/groups/join", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			Link string `json:"link"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Link == "" {
+			http.Error(w, "A group invite link is required", http.StatusBadRequest)
+			return
+		}
+
+		jid, err := JoinGroupViaLink(client, req.Link)
+		if err != nil {
+			writeGroupError(w, http.StatusInternalServerError, err)
+			return
+		}
+		json.NewEncoder(w).Encode(GroupActionResponse{Success: true, Message: "Joined group", Data: jid.String()})
+	})
+
+	http.HandleFunc("/api/groups/participants", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		groupJID, err := groupJIDFromQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			participants, err := messageStore.GetGroupParticipants(groupJID.String())
+			if err != nil {
+				writeGroupError(w, http.StatusInternalServerError, err)
+				return
+			}
+			json.NewEncoder(w).Encode(GroupActionResponse{Success: true, Data: participants})
+
+		case http.MethodPost:
+			var req struct {
+				Participants []string                    `json:"participants"`
+				Action       whatsmeow.ParticipantChange `json:"action"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request format", http.StatusBadRequest)
+				return
+			}
+			participants, err := UpdateGroupParticipants(client, groupJID, req.Participants, req.Action)
+			if err != nil {
+				writeGroupError(w, http.StatusInternalServerError, err)
+				return
+			}
+			json.NewEncoder(w).Encode(GroupActionResponse{Success: true, Data: participants})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	http.HandleFunc("/api/groups/leave", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		groupJID, err := groupJIDFromQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := LeaveGroup(client, groupJID); err != nil {
+			writeGroupError(w, http.StatusInternalServerError, err)
+			return
+		}
+		json.NewEncoder(w).Encode(GroupActionResponse{Success: true, Message: "Left group"})
+	})
+
+	http.HandleFunc("/api/groups/invite-link", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		groupJID, err := groupJIDFromQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reset := r.URL.Query().Get("reset") == "true"
+		link, err := GetGroupInviteLink(client, groupJID, reset)
+		if err != nil {
+			writeGroupError(w, http.StatusInternalServerError, err)
+			return
+		}
+		json.NewEncoder(w).Encode(GroupActionResponse{Success: true, Data: link})
+	})
+
+	http.HandleFunc("/api/groups/name", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		groupJID, err := groupJIDFromQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		if err := SetGroupName(client, groupJID, req.Name); err != nil {
+			writeGroupError(w, http.StatusInternalServerError, err)
+			return
+		}
+		json.NewEncoder(w).Encode(GroupActionResponse{Success: true, Message: "Group renamed"})
+	})
+
+	http.HandleFunc("/api/groups/topic", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		groupJID, err := groupJIDFromQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var req struct {
+			Topic string `json:"topic"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+		if err := SetGroupTopic(client, groupJID, req.Topic); err != nil {
+			writeGroupError(w, http.StatusInternalServerError, err)
+			return
+		}
+		json.NewEncoder(w).Encode(GroupActionResponse{Success: true, Message: "Group topic updated"})
+	})
+
+	logger.Infof("Registered group management API routes")
+}
+
+// groupJIDFromQuery parses the "jid" query parameter shared by the single-group endpoints.
+func groupJIDFromQuery(r *http.Request) (types.JID, error) {
+	jidParam := r.URL.Query().Get("jid")
+	if jidParam == "" {
+		return types.JID{}, fmt.Errorf("jid query parameter is required")
+	}
+	groupJID, err := types.ParseJID(jidParam)
+	if err != nil {
+		return types.JID{}, fmt.Errorf("invalid jid")
+	}
+	return groupJID, nil
+}
+
+// writeGroupError writes a GroupActionResponse failure with the given status code.
+func writeGroupError(w http.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(GroupActionResponse{Success: false, Message: err.Error()})
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// HistorySyncConfig controls how much history we ask WhatsApp to replay on login and how the
+// resulting batches are processed.
+type HistorySyncConfig struct {
+	MaxInitialConversations int
+	DaysLimit               int
+	SizeLimitMB             int
+	RequestFullSync         bool
+}
+
+// defaultHistorySyncConfig mirrors the previous hardcoded behavior (100 conversations, no limits).
+func defaultHistorySyncConfig() HistorySyncConfig {
+	return HistorySyncConfig{
+		MaxInitialConversations: 100,
+		DaysLimit:               0,
+		SizeLimitMB:             0,
+		RequestFullSync:         false,
+	}
+}
+
+// loadHistorySyncConfig builds a HistorySyncConfig from environment variables, falling back to
+// defaultHistorySyncConfig for anything unset.
+func loadHistorySyncConfig() HistorySyncConfig {
+	cfg := defaultHistorySyncConfig()
+
+	if v := os.Getenv("HISTORY_MAX_CONVERSATIONS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.MaxInitialConversations = n
+		}
+	}
+	if v := os.Getenv("HISTORY_DAYS_LIMIT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.DaysLimit = n
+		}
+	}
+	if v := os.Getenv("HISTORY_SIZE_LIMIT_MB"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.SizeLimitMB = n
+		}
+	}
+	if v := os.Getenv("HISTORY_REQUEST_FULL_SYNC"); v != "" {
+		cfg.RequestFullSync = v == "1" || strings.EqualFold(v, "true")
+	}
+
+	return cfg
+}
+
+// applyHistorySyncDeviceProps pushes cfg's full-sync knobs into store.DeviceProps.HistorySyncConfig,
+// the registration-time payload whatsmeow sends the phone to say how much history to replay. It
+// must run before the device pairs or reconnects, so call it once at startup right after
+// loadHistorySyncConfig.
+func applyHistorySyncDeviceProps(cfg HistorySyncConfig) {
+	hsc := store.DeviceProps.HistorySyncConfig
+	if cfg.RequestFullSync {
+		hsc.FullSyncDaysLimit = nil
+	} else if cfg.DaysLimit > 0 {
+		hsc.FullSyncDaysLimit = proto.Uint32(uint32(cfg.DaysLimit))
+	}
+	if cfg.SizeLimitMB > 0 {
+		hsc.FullSyncSizeMbLimit = proto.Uint32(uint32(cfg.SizeLimitMB))
+	}
+}
+
+// StoreSyncProgress records the oldest message we've synced for a chat so a later backfill knows
+// where to resume.
+func (store *MessageStore) StoreSyncProgress(chatJID, oldestMsgID string, oldestTimestamp time.Time, complete bool) error {
+	_, err := store.db.Exec(
+		`INSERT OR REPLACE INTO sync_progress (chat_jid, oldest_msg_id, oldest_timestamp, complete) VALUES (?, ?, ?, ?)`,
+		chatJID, oldestMsgID, oldestTimestamp.Format("2006-01-02 15:04:05"), complete,
+	)
+	return err
+}
+
+// GetSyncProgress returns the stored backfill cursor for a chat, if one exists.
+func (store *MessageStore) GetSyncProgress(chatJID string) (oldestMsgID string, oldestTimestamp time.Time, complete bool, err error) {
+	var timestampStr string
+	err = store.db.QueryRow(
+		"SELECT oldest_msg_id, oldest_timestamp, complete FROM sync_progress WHERE chat_jid = ?",
+		chatJID,
+	).Scan(&oldestMsgID, &timestampStr, &complete)
+	if err != nil {
+		return "", time.Time{}, false, err
+	}
+
+	oldestTimestamp, parseErr := time.Parse("2006-01-02 15:04:05", timestampStr)
+	if parseErr != nil {
+		oldestTimestamp = time.Time{}
+	}
+	return oldestMsgID, oldestTimestamp, complete, nil
+}
+
+// RequestHistoryBackfill asks WhatsApp for more history for a single chat, anchored at the oldest
+// message we've already synced for it, for on-demand backfill beyond the initial sync. It returns an
+// error when the chat has no stored cursor yet or its cursor is marked complete.
+func RequestHistoryBackfill(client *whatsmeow.Client, messageStore *MessageStore, chatJID string, count int) error {
+	if client == nil || !client.IsConnected() || client.Store.ID == nil {
+		return fmt.Errorf("client is not connected and logged in")
+	}
+
+	jid, err := types.ParseJID(chatJID)
+	if err != nil {
+		return fmt.Errorf("invalid chat_jid: %w", err)
+	}
+
+	oldestMsgID, oldestTimestamp, complete, err := messageStore.GetSyncProgress(chatJID)
+	if err == nil && complete {
+		return fmt.Errorf("chat %s has already been fully synced", chatJID)
+	}
+
+	if err != nil || oldestMsgID == "" {
+		// BuildHistorySyncRequest unconditionally dereferences its anchor, so we can't pass it nil
+		// for a chat that hasn't been through the initial sync yet; tell the caller to wait instead.
+		return fmt.Errorf("no history cursor for chat %s yet; it hasn't been through the initial sync", chatJID)
+	}
+
+	// Resume from where the last sync (initial or backfill) left off instead of re-requesting a
+	// generic/initial sync.
+	anchor := &types.MessageInfo{
+		ID:        oldestMsgID,
+		Timestamp: oldestTimestamp,
+		MessageSource: types.MessageSource{
+			Chat: jid,
+		},
+	}
+
+	historyMsg := client.BuildHistorySyncRequest(anchor, count)
+	if historyMsg == nil {
+		return fmt.Errorf("failed to build history sync request")
+	}
+
+	_, err = client.SendMessage(context.Background(), types.JID{
+		Server: "s.whatsapp.net",
+		User:   "status",
+	}, historyMsg)
+	return err
+}
+
+// registerHistoryHandlers wires up the /api/history/backfill endpoint onto the default mux.
+func registerHistoryHandlers(client *whatsmeow.Client, messageStore *MessageStore) {
+	http.HandleFunc("/api/history/backfill", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			ChatJID string `json:"chat_jid"`
+			Count   int    `json:"count"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChatJID == "" {
+			http.Error(w, "chat_jid is required", http.StatusBadRequest)
+			return
+		}
+		if req.Count <= 0 {
+			req.Count = 50
+		}
+
+		if err := RequestHistoryBackfill(client, messageStore, req.ChatJID, req.Count); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": err.Error()})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "Backfill requested"})
+	})
+}
@@ -14,7 +14,6 @@ import (
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
-	"github.com/mdp/qrterminal"
 
 	"go.mau.fi/whatsmeow"
 	waProto "go.mau.fi/whatsmeow/binary/proto"
@@ -65,19 +64,83 @@ func NewMessageStore() (*MessageStore, error) {
 			chat_jid TEXT,
 			sender TEXT,
 			content TEXT,
-			timestamp TIMESTAMP,
+			timestamp INTEGER,
 			is_from_me BOOLEAN,
 			media_type TEXT,
 			PRIMARY KEY (id, chat_jid),
 			FOREIGN KEY (chat_jid) REFERENCES chats(jid)
 		);
+
+		CREATE TABLE IF NOT EXISTS attachments (
+			id TEXT PRIMARY KEY,
+			chat_jid TEXT,
+			message_id TEXT,
+			mime_type TEXT,
+			file_name TEXT,
+			sha256 TEXT,
+			file_length INTEGER,
+			local_path TEXT,
+			caption TEXT,
+			FOREIGN KEY (chat_jid, message_id) REFERENCES messages(chat_jid, id)
+		);
+
+		CREATE TABLE IF NOT EXISTS group_participants (
+			chat_jid TEXT,
+			participant_jid TEXT,
+			is_admin BOOLEAN,
+			is_superadmin BOOLEAN,
+			PRIMARY KEY (chat_jid, participant_jid)
+		);
+
+		CREATE TABLE IF NOT EXISTS sync_progress (
+			chat_jid TEXT PRIMARY KEY,
+			oldest_msg_id TEXT,
+			oldest_timestamp TIMESTAMP,
+			complete BOOLEAN
+		);
+
+		CREATE TABLE IF NOT EXISTS presence (
+			jid TEXT PRIMARY KEY,
+			available BOOLEAN,
+			last_seen TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS receipts (
+			chat_jid TEXT,
+			message_id TEXT,
+			sender_jid TEXT,
+			receipt_type TEXT,
+			timestamp TIMESTAMP,
+			PRIMARY KEY (chat_jid, message_id, sender_jid)
+		);
+
+		CREATE TABLE IF NOT EXISTS webhook_outbox (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			event_type TEXT,
+			payload TEXT,
+			attempts INTEGER,
+			created_at INTEGER,
+			next_attempt_at INTEGER
+		);
 	`)
 	if err != nil {
 		db.Close()
 		return nil, fmt.Errorf("failed to create tables: %v", err)
 	}
 
-	return &MessageStore{db: db}, nil
+	store := &MessageStore{db: db}
+
+	if err := store.migrateTimestampColumn(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate timestamp column: %v", err)
+	}
+
+	if err := store.ensureSearchIndex(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to set up full-text search: %v", err)
+	}
+
+	return store, nil
 }
 
 // Close the database connection
@@ -98,8 +161,10 @@ func (store *MessageStore) StoreChat(jid, name string, lastMessageTime time.Time
 
 // Store a message in the database
 func (store *MessageStore) StoreMessage(id, chatJID, sender, content string, timestamp time.Time, isFromMe bool, mediaType string) error {
-	// Only store if there's actual content
-	if content == "" {
+	// Skip only plain-text messages with no content; media messages (voice notes, stickers,
+	// captionless images/videos/documents) still need a row so their attachment's FK reference
+	// and downstream queries resolve.
+	if content == "" && mediaType == "text" {
 		return nil
 	}
 
@@ -108,18 +173,27 @@ func (store *MessageStore) StoreMessage(id, chatJID, sender, content string, tim
 		sender = "unknown"
 	}
 
-	// Format the timestamp as a string for SQLite
-	formattedTime := timestamp.Format("2006-01-02 15:04:05")
+	// Store the timestamp as a Unix second count (INTEGER column) so range queries over it index cleanly
+	unixTime := timestamp.Unix()
 
 	// Debug: Log the values being inserted
 	fmt.Printf("Inserting message: id=%v, chat_jid=%v, sender=%v, content=%v, timestamp=%v, is_from_me=%v, media_type=%v\n",
-		id, chatJID, sender, content, formattedTime, isFromMe, mediaType)
+		id, chatJID, sender, content, unixTime, isFromMe, mediaType)
 
+	// Use a real UPSERT rather than INSERT OR REPLACE: the latter is implemented as a DELETE
+	// followed by an INSERT, but SQLite only fires that DELETE's triggers when recursive_triggers
+	// is on (which we don't enable), so messages_fts_delete never ran on a redelivered/updated
+	// message id and stale rows piled up in messages_fts.
 	_, err := store.db.Exec(
-		`INSERT OR REPLACE INTO messages 
-		(id, chat_jid, sender, content, timestamp, is_from_me, media_type) 
-		VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		id, chatJID, sender, content, formattedTime, isFromMe, mediaType,
+		`INSERT INTO messages (id, chat_jid, sender, content, timestamp, is_from_me, media_type)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id, chat_jid) DO UPDATE SET
+			sender = excluded.sender,
+			content = excluded.content,
+			timestamp = excluded.timestamp,
+			is_from_me = excluded.is_from_me,
+			media_type = excluded.media_type`,
+		id, chatJID, sender, content, unixTime, isFromMe, mediaType,
 	)
 	return err
 }
@@ -138,17 +212,12 @@ func (store *MessageStore) GetMessages(chatJID string, limit int) ([]Message, er
 	var messages []Message
 	for rows.Next() {
 		var msg Message
-		var timestampStr string
-		err := rows.Scan(&msg.Sender, &msg.Content, &timestampStr, &msg.IsFromMe, &msg.MediaType)
+		var unixTime int64
+		err := rows.Scan(&msg.Sender, &msg.Content, &unixTime, &msg.IsFromMe, &msg.MediaType)
 		if err != nil {
 			return nil, err
 		}
-		// Parse the timestamp string back into a time.Time
-		msg.Time, err = time.Parse("2006-01-02 15:04:05", timestampStr)
-		if err != nil {
-			// If parsing fails, use a zero time
-			msg.Time = time.Time{}
-		}
+		msg.Time = time.Unix(unixTime, 0)
 		messages = append(messages, msg)
 	}
 
@@ -255,8 +324,8 @@ func sendWhatsAppMessage(client *whatsmeow.Client, recipient string, message str
 	return true, fmt.Sprintf("Message sent to %s", recipient)
 }
 
-// Handle regular incoming messages (text only)
-func handleMessage(client *whatsmeow.Client, messageStore *MessageStore, msg *events.Message, logger waLog.Logger) {
+// Handle incoming messages, including media (image, video, audio, document, sticker)
+func handleMessage(client *whatsmeow.Client, messageStore *MessageStore, msg *events.Message, dispatcher *WebhookDispatcher, logger waLog.Logger) {
 	// Save message to database
 	chatJID := msg.Info.Chat.String()
 	sender := msg.Info.Sender.User
@@ -270,16 +339,25 @@ func handleMessage(client *whatsmeow.Client, messageStore *MessageStore, msg *ev
 		logger.Warnf("Failed to store chat: %v", err)
 	}
 
-	// Extract text content
+	// Extract text content, falling back to the media caption (if any) so media messages
+	// remain queryable by what they say
 	content := extractTextContent(msg.Message)
+	mediaType := "text"
+
+	media := extractMediaMessage(msg.Message)
+	if media != nil {
+		mediaType = media.mediaType
+		if media.caption != "" {
+			content = media.caption
+		}
+	}
 
-	// Skip if there's no text content
-	if content == "" {
+	// Skip if there's no text content and no media to process
+	if content == "" && media == nil {
 		logger.Infof("Skipping message from %s: Not a text message", sender)
 		return
 	}
 
-	// Store message in database (media_type is always 'text')
 	err = messageStore.StoreMessage(
 		msg.Info.ID,
 		chatJID,
@@ -287,24 +365,48 @@ func handleMessage(client *whatsmeow.Client, messageStore *MessageStore, msg *ev
 		content,
 		msg.Info.Timestamp,
 		msg.Info.IsFromMe,
-		"text",
+		mediaType,
 	)
 
 	if err != nil {
 		logger.Warnf("Failed to store message: %v", err)
-	} else {
-		// Log message reception
-		timestamp := msg.Info.Timestamp.Format("2006-01-02 15:04:05")
-		direction := "←"
-		if msg.Info.IsFromMe {
-			direction = "→"
-		}
-		fmt.Printf("[%s] %s %s: %s\n", timestamp, direction, sender, content)
+		return
+	}
+
+	// Log message reception
+	timestamp := msg.Info.Timestamp.Format("2006-01-02 15:04:05")
+	direction := "←"
+	if msg.Info.IsFromMe {
+		direction = "→"
+	}
+	fmt.Printf("[%s] %s %s: %s\n", timestamp, direction, sender, content)
+
+	// Fetch and decrypt the attachment in the background so we never block message storage on it
+	if media != nil {
+		go downloadAttachmentAsync(client, chatJID, msg.Info.ID, media, logger)
+	}
+
+	if dispatcher != nil {
+		dispatcher.Dispatch("message", map[string]interface{}{
+			"id":         msg.Info.ID,
+			"chat_jid":   chatJID,
+			"sender":     sender,
+			"content":    content,
+			"timestamp":  msg.Info.Timestamp.Unix(),
+			"is_from_me": msg.Info.IsFromMe,
+			"media_type": mediaType,
+		})
 	}
 }
 
 // Start a REST API server to expose the WhatsApp client functionality
 func startRESTServer(client *whatsmeow.Client, messageStore *MessageStore, port int) {
+	logger := waLog.Stdout("REST", "DEBUG", true)
+	registerGroupHandlers(client, messageStore, logger)
+	registerHistoryHandlers(client, messageStore)
+	registerPresenceHandlers(client)
+	registerSearchHandlers(messageStore)
+
 	// Handler for sending messages
 	http.HandleFunc("/api/send", func(w http.ResponseWriter, r *http.Request) {
 		// Only allow POST requests
@@ -381,44 +483,63 @@ func main() {
 		return
 	}
 
-	// Get the device store
-	deviceStore, err := container.GetFirstDevice()
+	// Open the message store shared by the REST API and the webhook outbox
+	messageStore, err := NewMessageStore()
 	if err != nil {
-		logger.Errorf("Failed to get device store: %v", err)
+		logger.Errorf("Failed to initialize message store: %v", err)
 		return
 	}
+	defer messageStore.Close()
 
-	// Create the client
-	client := whatsmeow.NewClient(deviceStore, logger)
-	client.AddEventHandler(handleEvent)
+	// Outbound event webhook. Dispatch is a no-op when WEBHOOK_URL isn't set.
+	webhookDispatcher := NewWebhookDispatcher(loadWebhookConfig(), messageStore, logger)
+	webhookDispatcher.StartRetryLoop()
 
-	// Connect to WhatsApp
-	if client.Store.ID == nil {
-		// No ID stored, new login
-		qrChan, _ := client.GetQRChannel(context.Background())
-		err = client.Connect()
+	// Get (or create) the first device. Provisioning a brand new device no longer blocks this
+	// goroutine on a terminal QR code: that now happens asynchronously through the provisioning
+	// API's GET /api/login (QR over websocket) and POST /api/login/phone (pairing code).
+	historySyncCfg := loadHistorySyncConfig()
+	applyHistorySyncDeviceProps(historySyncCfg)
+	provAPI := NewProvisioningAPI(container, historySyncCfg, webhookDispatcher, logger)
+
+	devices, err := container.GetAllDevices()
+	if err != nil {
+		logger.Errorf("Failed to list stored devices: %v", err)
+		return
+	}
+
+	var client *whatsmeow.Client
+	if len(devices) == 0 {
+		// Nothing paired yet: create an empty device store so the REST API has a client to hand
+		// requests to. GET /api/login and POST /api/login/phone pair a new device and client of
+		// their own and register that with the provisioning API; this client stays unpaired.
+		deviceStore, err := container.GetFirstDevice()
 		if err != nil {
-			logger.Errorf("Failed to connect: %v", err)
+			logger.Errorf("Failed to get device store: %v", err)
 			return
 		}
-		for evt := range qrChan {
-			if evt.Event == "code" {
-				// Print the QR code
-				qrterminal.GenerateHalfBlock(evt.Code, qrterminal.L, os.Stdout)
-			} else {
-				logger.Infof("QR channel event: %s", evt.Event)
-			}
-		}
+		client = whatsmeow.NewClient(deviceStore, logger)
+		logger.Infof("No device paired yet. GET /api/login (websocket) to scan a QR code, or POST /api/login/phone for a pairing code.")
 	} else {
-		// Already logged in, just connect
-		err = client.Connect()
-		if err != nil {
-			logger.Errorf("Failed to connect: %v", err)
+		// Already-paired devices are connected and registered by LoadExistingDevices; reuse that
+		// client instead of dialing a second whatsmeow.Client for the same JID.
+		if err := provAPI.LoadExistingDevices(); err != nil {
+			logger.Warnf("Failed to load stored devices: %v", err)
+		}
+		client = provAPI.activeClient("")
+		if client == nil {
+			logger.Errorf("Failed to connect any stored device")
 			return
 		}
 	}
 
-	// Start the HTTP server
+	// Keep WhatsApp sending us presence updates for known contacts
+	StartPresenceRefreshLoop(client, logger)
+
+	startRESTServer(client, messageStore, 8080)
+
+	// Start the MCP + provisioning HTTP server
+	provAPI.RegisterRoutes()
 	http.HandleFunc("/mcp/callTool", handleMCPCall)
 	go func() {
 		logger.Infof("Starting HTTP server on :8000")
@@ -520,9 +641,15 @@ func GetChatName(client *whatsmeow.Client, messageStore *MessageStore, jid types
 }
 
 // Handle history sync events (text only)
-func handleHistorySync(client *whatsmeow.Client, messageStore *MessageStore, historySync *events.HistorySync, logger waLog.Logger) {
+func handleHistorySync(client *whatsmeow.Client, messageStore *MessageStore, historySync *events.HistorySync, cfg HistorySyncConfig, logger waLog.Logger) {
 	fmt.Printf("Received history sync event with %d conversations\n", len(historySync.Data.Conversations))
 
+	const batchSize = 100
+	var cutoff time.Time
+	if cfg.DaysLimit > 0 {
+		cutoff = time.Now().AddDate(0, 0, -cfg.DaysLimit)
+	}
+
 	syncedCount := 0
 	for _, conversation := range historySync.Data.Conversations {
 		// Parse JID from the conversation
@@ -544,25 +671,43 @@ func handleHistorySync(client *whatsmeow.Client, messageStore *MessageStore, his
 
 		// Process messages
 		messages := conversation.Messages
-		if len(messages) > 0 {
-			// Update chat with latest message timestamp
-			latestMsg := messages[0]
-			if latestMsg == nil || latestMsg.Message == nil {
-				continue
-			}
+		if len(messages) == 0 {
+			continue
+		}
 
-			// Get timestamp from message info
-			timestamp := time.Time{}
-			if ts := latestMsg.Message.GetMessageTimestamp(); ts != 0 {
-				timestamp = time.Unix(int64(ts), 0)
-			} else {
-				continue
+		// Update chat with latest message timestamp
+		latestMsg := messages[0]
+		if latestMsg == nil || latestMsg.Message == nil {
+			continue
+		}
+		latestTimestamp := time.Time{}
+		if ts := latestMsg.Message.GetMessageTimestamp(); ts != 0 {
+			latestTimestamp = time.Unix(int64(ts), 0)
+		} else {
+			continue
+		}
+		messageStore.StoreChat(chatJID, name, latestTimestamp)
+
+		// oldestID/oldestTimestamp track the sync_progress cursor for this chat so a later
+		// on-demand backfill knows where to resume
+		var oldestID string
+		oldestTimestamp := latestTimestamp
+		complete := true
+
+		// Process messages in bounded batches, each inside its own transaction
+		for batchStart := 0; batchStart < len(messages); batchStart += batchSize {
+			batchEnd := batchStart + batchSize
+			if batchEnd > len(messages) {
+				batchEnd = len(messages)
 			}
 
-			messageStore.StoreChat(chatJID, name, timestamp)
+			tx, err := messageStore.db.Begin()
+			if err != nil {
+				logger.Warnf("Failed to start history sync transaction for %s: %v", chatJID, err)
+				break
+			}
 
-			// Store messages
-			for _, msg := range messages {
+			for _, msg := range messages[batchStart:batchEnd] {
 				if msg == nil || msg.Message == nil {
 					continue
 				}
@@ -582,9 +727,6 @@ func handleHistorySync(client *whatsmeow.Client, messageStore *MessageStore, his
 					continue
 				}
 
-				// Log the message content for debugging
-				logger.Infof("Message content: %v", content)
-
 				// Determine sender
 				var sender string
 				isFromMe := false
@@ -617,32 +759,52 @@ func handleHistorySync(client *whatsmeow.Client, messageStore *MessageStore, his
 					continue
 				}
 
-				err = messageStore.StoreMessage(
-					msgID,
-					chatJID,
-					sender,
-					content,
-					timestamp,
-					isFromMe,
-					"text",
+				if !cutoff.IsZero() && timestamp.Before(cutoff) {
+					// There's more history beyond our day limit; record the chat as incomplete
+					complete = false
+					continue
+				}
+
+				// Deduplicate against rows already synced for this (id, chat_jid)
+				var exists int
+				if scanErr := tx.QueryRow("SELECT 1 FROM messages WHERE id = ? AND chat_jid = ?", msgID, chatJID).Scan(&exists); scanErr == nil {
+					continue
+				}
+
+				_, err = tx.Exec(
+					`INSERT OR REPLACE INTO messages (id, chat_jid, sender, content, timestamp, is_from_me, media_type)
+					VALUES (?, ?, ?, ?, ?, ?, ?)`,
+					msgID, chatJID, sender, content, timestamp.Unix(), isFromMe, "text",
 				)
 				if err != nil {
 					logger.Warnf("Failed to store history message: %v", err)
-				} else {
-					syncedCount++
-					// Log successful message storage
-					logger.Infof("Stored message: [%s] %s -> %s: %s",
-						timestamp.Format("2006-01-02 15:04:05"), sender, chatJID, content)
+					continue
+				}
+
+				syncedCount++
+				if oldestID == "" || timestamp.Before(oldestTimestamp) {
+					oldestID = msgID
+					oldestTimestamp = timestamp
 				}
 			}
+
+			if err := tx.Commit(); err != nil {
+				logger.Warnf("Failed to commit history sync batch for %s: %v", chatJID, err)
+			}
+		}
+
+		if oldestID != "" {
+			if err := messageStore.StoreSyncProgress(chatJID, oldestID, oldestTimestamp, complete); err != nil {
+				logger.Warnf("Failed to store sync progress for %s: %v", chatJID, err)
+			}
 		}
 	}
 
 	fmt.Printf("History sync complete. Stored %d messages.\n", syncedCount)
 }
 
-// Request history sync from the server
-func requestHistorySync(client *whatsmeow.Client) {
+// Request history sync from the server, bounded by cfg
+func requestHistorySync(client *whatsmeow.Client, cfg HistorySyncConfig) {
 	if client == nil {
 		fmt.Println("Client is not initialized. Cannot request history sync.")
 		return
@@ -659,7 +821,7 @@ func requestHistorySync(client *whatsmeow.Client) {
 	}
 
 	// Build and send a history sync request
-	historyMsg := client.BuildHistorySyncRequest(nil, 100)
+	historyMsg := client.BuildHistorySyncRequest(nil, cfg.MaxInitialConversations)
 	if historyMsg == nil {
 		fmt.Println("Failed to build history sync request.")
 		return
@@ -678,8 +840,23 @@ func requestHistorySync(client *whatsmeow.Client) {
 }
 
 // Handle WhatsApp events
-func handleEvent(evt interface{}) {
+func handleEvent(client *whatsmeow.Client, logger waLog.Logger, historySyncCfg HistorySyncConfig, dispatcher *WebhookDispatcher, evt interface{}) {
 	switch v := evt.(type) {
+	case *events.HistorySync:
+		messageStore, err := NewMessageStore()
+		if err != nil {
+			fmt.Printf("Error creating message store: %v\n", err)
+			return
+		}
+		defer messageStore.Close()
+
+		handleHistorySync(client, messageStore, v, historySyncCfg, logger)
+		if dispatcher != nil {
+			dispatcher.Dispatch("history_sync", map[string]interface{}{
+				"conversations": len(v.Data.Conversations),
+			})
+		}
+
 	case *events.Message:
 		// Process incoming message
 		messageStore, err := NewMessageStore()
@@ -689,34 +866,73 @@ func handleEvent(evt interface{}) {
 		}
 		defer messageStore.Close()
 
-		// Extract message info
-		chatJID := v.Info.Chat.String()
-		sender := v.Info.Sender.String()
-		content := extractTextContent(v.Message)
-		timestamp := v.Info.Timestamp
-		isFromMe := v.Info.IsFromMe
-		mediaType := "text"
-		if v.Message.GetImageMessage() != nil {
-			mediaType = "image"
-		} else if v.Message.GetVideoMessage() != nil {
-			mediaType = "video"
-		} else if v.Message.GetAudioMessage() != nil {
-			mediaType = "audio"
-		} else if v.Message.GetDocumentMessage() != nil {
-			mediaType = "document"
-		}
-
-		// Store message in database
-		err = messageStore.StoreMessage(v.Info.ID, chatJID, sender, content, timestamp, isFromMe, mediaType)
+		handleMessage(client, messageStore, v, dispatcher, logger)
+
+	case *events.GroupInfo:
+		messageStore, err := NewMessageStore()
+		if err != nil {
+			fmt.Printf("Error creating message store: %v\n", err)
+			return
+		}
+		defer messageStore.Close()
+
+		handleGroupInfo(messageStore, v, logger)
+		if dispatcher != nil {
+			dispatcher.Dispatch("group_info", map[string]interface{}{"chat_jid": v.JID.String()})
+		}
+
+	case *events.JoinedGroup:
+		messageStore, err := NewMessageStore()
+		if err != nil {
+			fmt.Printf("Error creating message store: %v\n", err)
+			return
+		}
+		defer messageStore.Close()
+
+		handleJoinedGroup(client, messageStore, v, logger)
+
+	case *events.Presence:
+		messageStore, err := NewMessageStore()
+		if err != nil {
+			fmt.Printf("Error creating message store: %v\n", err)
+			return
+		}
+		defer messageStore.Close()
+
+		handlePresence(messageStore, v, logger)
+
+	case *events.ChatPresence:
+		handleChatPresence(v, logger)
+
+	case *events.Receipt:
+		messageStore, err := NewMessageStore()
 		if err != nil {
-			fmt.Printf("Error storing message: %v\n", err)
+			fmt.Printf("Error creating message store: %v\n", err)
+			return
+		}
+		defer messageStore.Close()
+
+		handleReceipt(messageStore, v, logger)
+		if dispatcher != nil {
+			dispatcher.Dispatch("receipt", map[string]interface{}{
+				"chat_jid":     v.Chat.String(),
+				"sender":       v.Sender.String(),
+				"message_ids":  v.MessageIDs,
+				"receipt_type": string(v.Type),
+			})
 		}
 
 	case *events.Connected:
 		fmt.Println("Connected to WhatsApp!")
+		if dispatcher != nil {
+			dispatcher.Dispatch("connected", nil)
+		}
 
 	case *events.Disconnected:
 		fmt.Println("Disconnected from WhatsApp")
+		if dispatcher != nil {
+			dispatcher.Dispatch("disconnected", nil)
+		}
 
 	case *events.LoggedOut:
 		fmt.Println("Logged out from WhatsApp")
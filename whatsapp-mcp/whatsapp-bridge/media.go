@@ -0,0 +1,177 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// Attachment represents a piece of media (image, video, audio, document, or sticker)
+// attached to a message, once it has been downloaded and decrypted.
+type Attachment struct {
+	ID         string
+	ChatJID    string
+	MessageID  string
+	MimeType   string
+	FileName   string
+	SHA256     string
+	FileLength uint64
+	LocalPath  string
+	Caption    string
+}
+
+// StoreAttachment records (or replaces) the attachment metadata for a message.
+func (store *MessageStore) StoreAttachment(att Attachment) error {
+	_, err := store.db.Exec(
+		`INSERT OR REPLACE INTO attachments
+		(id, chat_jid, message_id, mime_type, file_name, sha256, file_length, local_path, caption)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		att.ID, att.ChatJID, att.MessageID, att.MimeType, att.FileName, att.SHA256, att.FileLength, att.LocalPath, att.Caption,
+	)
+	return err
+}
+
+// GetAttachment fetches the attachment stored for a given message, if any has been downloaded.
+func (store *MessageStore) GetAttachment(chatJID, messageID string) (*Attachment, error) {
+	var att Attachment
+	err := store.db.QueryRow(
+		`SELECT id, chat_jid, message_id, mime_type, file_name, sha256, file_length, local_path, caption
+		FROM attachments WHERE chat_jid = ? AND message_id = ?`,
+		chatJID, messageID,
+	).Scan(&att.ID, &att.ChatJID, &att.MessageID, &att.MimeType, &att.FileName, &att.SHA256, &att.FileLength, &att.LocalPath, &att.Caption)
+	if err != nil {
+		return nil, err
+	}
+	return &att, nil
+}
+
+// mediaMessage bundles the fields we need out of whichever media message type a
+// *waProto.Message actually carries, so the rest of the pipeline doesn't need to care which one it is.
+type mediaMessage struct {
+	downloadable whatsmeow.DownloadableMessage
+	mediaType    string
+	mimeType     string
+	fileName     string
+	fileLength   uint64
+	caption      string
+}
+
+// extractMediaMessage returns the downloadable media carried by msg, or nil if msg has none.
+func extractMediaMessage(msg *waProto.Message) *mediaMessage {
+	if msg == nil {
+		return nil
+	}
+
+	if img := msg.GetImageMessage(); img != nil {
+		return &mediaMessage{img, "image", img.GetMimetype(), "", img.GetFileLength(), img.GetCaption()}
+	}
+	if vid := msg.GetVideoMessage(); vid != nil {
+		return &mediaMessage{vid, "video", vid.GetMimetype(), "", vid.GetFileLength(), vid.GetCaption()}
+	}
+	if doc := msg.GetDocumentMessage(); doc != nil {
+		return &mediaMessage{doc, "document", doc.GetMimetype(), doc.GetFileName(), doc.GetFileLength(), doc.GetCaption()}
+	}
+	if aud := msg.GetAudioMessage(); aud != nil {
+		mediaType := "audio"
+		if aud.GetPTT() {
+			mediaType = "ptt"
+		}
+		return &mediaMessage{aud, mediaType, aud.GetMimetype(), "", aud.GetFileLength(), ""}
+	}
+	if sticker := msg.GetStickerMessage(); sticker != nil {
+		return &mediaMessage{sticker, "sticker", sticker.GetMimetype(), "", sticker.GetFileLength(), ""}
+	}
+
+	return nil
+}
+
+// downloadAttachmentAsync opens its own MessageStore (following the rest of the bridge's
+// per-event store pattern) and fetches, decrypts, and persists msg's attachment. It is meant
+// to be run in its own goroutine so the synchronous message-storage path never blocks on it.
+func downloadAttachmentAsync(client *whatsmeow.Client, chatJID, messageID string, media *mediaMessage, logger waLog.Logger) {
+	store, err := NewMessageStore()
+	if err != nil {
+		logger.Warnf("Failed to open message store for attachment download: %v", err)
+		return
+	}
+	defer store.Close()
+
+	data, err := client.Download(media.downloadable)
+	if err != nil {
+		logger.Warnf("Failed to download %s attachment for message %s: %v", media.mediaType, messageID, err)
+		return
+	}
+
+	dir := filepath.Join("store", "media", sanitizeChatJID(chatJID))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		logger.Warnf("Failed to create media directory %s: %v", dir, err)
+		return
+	}
+
+	fileName := sanitizeFileName(media.fileName)
+	if fileName == "" {
+		fileName = messageID + mediaExtension(media.mimeType)
+	}
+	localPath := filepath.Join(dir, fileName)
+
+	if err := os.WriteFile(localPath, data, 0644); err != nil {
+		logger.Warnf("Failed to save attachment to %s: %v", localPath, err)
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	att := Attachment{
+		ID:         chatJID + ":" + messageID,
+		ChatJID:    chatJID,
+		MessageID:  messageID,
+		MimeType:   media.mimeType,
+		FileName:   fileName,
+		SHA256:     hex.EncodeToString(sum[:]),
+		FileLength: media.fileLength,
+		LocalPath:  localPath,
+		Caption:    media.caption,
+	}
+	if err := store.StoreAttachment(att); err != nil {
+		logger.Warnf("Failed to store attachment metadata for message %s: %v", messageID, err)
+		return
+	}
+
+	logger.Infof("Downloaded %s attachment for message %s to %s", media.mediaType, messageID, localPath)
+}
+
+// mediaExtension derives a file extension (with leading dot) from a MIME type, e.g. "image/jpeg" -> ".jpeg".
+func mediaExtension(mimeType string) string {
+	sub := mimeType
+	if idx := strings.IndexByte(sub, ';'); idx >= 0 {
+		sub = sub[:idx]
+	}
+	if idx := strings.IndexByte(sub, '/'); idx >= 0 {
+		sub = sub[idx+1:]
+	}
+	if sub == "" {
+		return ""
+	}
+	return "." + sub
+}
+
+// sanitizeChatJID makes a chat JID safe to use as a path component.
+func sanitizeChatJID(chatJID string) string {
+	return strings.NewReplacer("@", "_", ":", "_").Replace(chatJID)
+}
+
+// sanitizeFileName strips any directory components from a remote-supplied file name (e.g. a
+// document message's fileName, which is attacker-controlled) so it can't escape the media
+// directory via "../" path traversal. Returns "" if nothing safe is left.
+func sanitizeFileName(fileName string) string {
+	cleaned := filepath.Base(filepath.Clean(fileName))
+	if cleaned == "." || cleaned == ".." || cleaned == string(filepath.Separator) {
+		return ""
+	}
+	return cleaned
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// presenceRefreshInterval is the base interval for the periodic SubscribePresence refresh loop.
+// WhatsApp stops pushing presence updates for a contact after a while unless we keep re-subscribing.
+const presenceRefreshInterval = 12 * time.Hour
+
+// StorePresence records the last known available/unavailable state and last-seen time for a JID.
+func (store *MessageStore) StorePresence(jid string, available bool, lastSeen time.Time) error {
+	_, err := store.db.Exec(
+		"INSERT OR REPLACE INTO presence (jid, available, last_seen) VALUES (?, ?, ?)",
+		jid, available, lastSeen.Format("2006-01-02 15:04:05"),
+	)
+	return err
+}
+
+// StoreReceipt records a delivery or read receipt for a message.
+func (store *MessageStore) StoreReceipt(chatJID, messageID, senderJID, receiptType string, timestamp time.Time) error {
+	_, err := store.db.Exec(
+		`INSERT OR REPLACE INTO receipts (chat_jid, message_id, sender_jid, receipt_type, timestamp)
+		VALUES (?, ?, ?, ?, ?)`,
+		chatJID, messageID, senderJID, receiptType, timestamp.Format("2006-01-02 15:04:05"),
+	)
+	return err
+}
+
+// handlePresence persists a contact's availability and last-seen time.
+func handlePresence(messageStore *MessageStore, evt *events.Presence, logger waLog.Logger) {
+	lastSeen := evt.LastSeen
+	if lastSeen.IsZero() {
+		lastSeen = time.Now()
+	}
+	if err := messageStore.StorePresence(evt.From.String(), !evt.Unavailable, lastSeen); err != nil {
+		logger.Warnf("Failed to store presence for %s: %v", evt.From, err)
+	}
+}
+
+// handleChatPresence logs a composing/paused/recording indicator. Typing state is too ephemeral
+// to be worth persisting, so we only surface it in the logs.
+func handleChatPresence(evt *events.ChatPresence, logger waLog.Logger) {
+	logger.Infof("%s is %s in %s", evt.Sender, evt.State, evt.Chat)
+}
+
+// handleReceipt persists a delivery or read receipt for every message it covers.
+func handleReceipt(messageStore *MessageStore, evt *events.Receipt, logger waLog.Logger) {
+	for _, id := range evt.MessageIDs {
+		if err := messageStore.StoreReceipt(evt.Chat.String(), id, evt.Sender.String(), string(evt.Type), evt.Timestamp); err != nil {
+			logger.Warnf("Failed to store receipt for message %s: %v", id, err)
+		}
+	}
+}
+
+// SendPresence broadcasts our own availability (available/unavailable) to WhatsApp.
+func SendPresence(client *whatsmeow.Client, available bool) error {
+	presence := types.PresenceUnavailable
+	if available {
+		presence = types.PresenceAvailable
+	}
+	return client.SendPresence(presence)
+}
+
+// SendChatPresence sends a typing/recording indicator for a specific chat. media distinguishes a
+// plain composing indicator (types.ChatPresenceMediaText) from a recording one
+// (types.ChatPresenceMediaAudio).
+func SendChatPresence(client *whatsmeow.Client, chatJID types.JID, state types.ChatPresence, media types.ChatPresenceMedia) error {
+	return client.SendChatPresence(chatJID, state, media)
+}
+
+// MarkRead marks one or more messages in a chat as read.
+func MarkRead(client *whatsmeow.Client, chatJID, sender types.JID, ids []types.MessageID) error {
+	return client.MarkRead(ids, time.Now(), chatJID, sender)
+}
+
+// StartPresenceRefreshLoop periodically re-subscribes to presence updates for every known contact,
+// jittered around presenceRefreshInterval so WhatsApp keeps sending us updates.
+func StartPresenceRefreshLoop(client *whatsmeow.Client, logger waLog.Logger) {
+	go func() {
+		for {
+			jitter := time.Duration(rand.Int63n(int64(presenceRefreshInterval / 2)))
+			time.Sleep(presenceRefreshInterval - presenceRefreshInterval/4 + jitter)
+
+			if !client.IsConnected() {
+				continue
+			}
+
+			contacts, err := client.Store.Contacts.GetAllContacts()
+			if err != nil {
+				logger.Warnf("Failed to list contacts for presence refresh: %v", err)
+				continue
+			}
+
+			for jid := range contacts {
+				if err := client.SubscribePresence(jid); err != nil {
+					logger.Warnf("Failed to subscribe to presence for %s: %v", jid, err)
+				}
+			}
+			logger.Infof("Refreshed presence subscriptions for %d contacts", len(contacts))
+		}
+	}()
+}
+
+// registerPresenceHandlers wires up the presence/typing/read-receipt endpoints onto the default mux.
+func registerPresenceHandlers(client *whatsmeow.Client) {
+	http.HandleFunc("/api/presence", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			Available bool `json:"available"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+
+		if err := SendPresence(client, req.Available); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	})
+
+	http.HandleFunc("/api/chats/presence", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			ChatJID string `json:"chat_jid"`
+			State   string `json:"state"` // "composing", "paused", or "recording"
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChatJID == "" {
+			http.Error(w, "chat_jid is required", http.StatusBadRequest)
+			return
+		}
+
+		chatJID, err := types.ParseJID(req.ChatJID)
+		if err != nil {
+			http.Error(w, "Invalid chat_jid", http.StatusBadRequest)
+			return
+		}
+
+		state := types.ChatPresenceComposing
+		media := types.ChatPresenceMediaText
+		switch req.State {
+		case "paused":
+			state = types.ChatPresencePaused
+		case "recording":
+			state = types.ChatPresenceComposing
+			media = types.ChatPresenceMediaAudio
+		}
+
+		if err := SendChatPresence(client, chatJID, state, media); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	})
+
+	http.HandleFunc("/api/messages/read", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			ChatJID    string   `json:"chat_jid"`
+			SenderJID  string   `json:"sender_jid"`
+			MessageIDs []string `json:"message_ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChatJID == "" || len(req.MessageIDs) == 0 {
+			http.Error(w, "chat_jid and message_ids are required", http.StatusBadRequest)
+			return
+		}
+
+		chatJID, err := types.ParseJID(req.ChatJID)
+		if err != nil {
+			http.Error(w, "Invalid chat_jid", http.StatusBadRequest)
+			return
+		}
+		senderJID := chatJID
+		if req.SenderJID != "" {
+			senderJID, err = types.ParseJID(req.SenderJID)
+			if err != nil {
+				http.Error(w, "Invalid sender_jid", http.StatusBadRequest)
+				return
+			}
+		}
+
+		ids := make([]types.MessageID, len(req.MessageIDs))
+		for i, id := range req.MessageIDs {
+			ids[i] = types.MessageID(id)
+		}
+
+		if err := MarkRead(client, chatJID, senderJID, ids); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	})
+}
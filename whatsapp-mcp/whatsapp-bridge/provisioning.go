@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// loginTimeout bounds how long a /api/login websocket waits for its QR code to be scanned.
+const loginTimeout = 3 * time.Minute
+
+var provisioningUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// ProvisioningAPI manages every WhatsApp device this process hosts and exposes the HTTP endpoints
+// used to add, inspect, and remove them, similar in spirit to mautrix-whatsapp's provisioning.go.
+type ProvisioningAPI struct {
+	container  *sqlstore.Container
+	historyCfg HistorySyncConfig
+	dispatcher *WebhookDispatcher
+	logger     waLog.Logger
+
+	mu           sync.Mutex
+	clients      map[string]*whatsmeow.Client  // device JID string -> client
+	connManagers map[string]*ConnectionManager // device JID string -> its reconnect/health monitor
+	activeJID    string
+}
+
+// NewProvisioningAPI creates a ProvisioningAPI backed by the given device container.
+func NewProvisioningAPI(container *sqlstore.Container, historyCfg HistorySyncConfig, dispatcher *WebhookDispatcher, logger waLog.Logger) *ProvisioningAPI {
+	return &ProvisioningAPI{
+		container:    container,
+		historyCfg:   historyCfg,
+		dispatcher:   dispatcher,
+		logger:       logger,
+		clients:      make(map[string]*whatsmeow.Client),
+		connManagers: make(map[string]*ConnectionManager),
+	}
+}
+
+// LoadExistingDevices connects every already-paired device stored in the container so a restart
+// doesn't require re-pairing.
+func (p *ProvisioningAPI) LoadExistingDevices() error {
+	devices, err := p.container.GetAllDevices()
+	if err != nil {
+		return err
+	}
+
+	for _, device := range devices {
+		if device.ID == nil {
+			continue
+		}
+
+		client := whatsmeow.NewClient(device, p.logger)
+		client.AddEventHandler(func(evt interface{}) {
+			handleEvent(client, p.logger, p.historyCfg, p.dispatcher, evt)
+		})
+		if err := client.Connect(); err != nil {
+			p.logger.Warnf("Failed to connect stored device %s: %v", device.ID, err)
+			continue
+		}
+		p.registerClient(client)
+	}
+
+	return nil
+}
+
+// registerClient adds an already-connected client to the pool, making it active if it's the first one.
+func (p *ProvisioningAPI) registerClient(client *whatsmeow.Client) {
+	if client.Store.ID == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	jid := client.Store.ID.String()
+	p.clients[jid] = client
+	if _, ok := p.connManagers[jid]; !ok {
+		p.connManagers[jid] = NewConnectionManager(client, p.logger)
+	}
+	if p.activeJID == "" {
+		p.activeJID = jid
+	}
+}
+
+// activeClient returns the client for requestedJID, or the default active device if requestedJID is empty.
+func (p *ProvisioningAPI) activeClient(requestedJID string) *whatsmeow.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	jid := requestedJID
+	if jid == "" {
+		jid = p.activeJID
+	}
+	return p.clients[jid]
+}
+
+// RegisterRoutes wires up the provisioning endpoints onto the default mux.
+func (p *ProvisioningAPI) RegisterRoutes() {
+	http.HandleFunc("/api/login", p.handleLogin)
+	http.HandleFunc("/api/login/phone", p.handleLoginPhone)
+	http.HandleFunc("/api/logout", p.handleLogout)
+	http.HandleFunc("/api/status", p.handleStatus)
+	http.HandleFunc("/api/session", p.handleSession)
+}
+
+// handleLogin streams QR codes over a websocket until the user scans one, the device logs in, or loginTimeout elapses.
+// A websocket handshake is always a GET request, so that is the method accepted here.
+func (p *ProvisioningAPI) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	conn, err := provisioningUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		p.logger.Warnf("Failed to upgrade login websocket: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	device := p.container.NewDevice()
+	client := whatsmeow.NewClient(device, p.logger)
+
+	// Most QR prompts are never scanned: unless registerClient below claims the client, disconnect
+	// it here so an abandoned pairing attempt doesn't leak a connecting whatsmeow.Client forever.
+	registered := false
+	defer func() {
+		if !registered {
+			client.Disconnect()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), loginTimeout)
+	defer cancel()
+
+	qrChan, err := client.GetQRChannel(ctx)
+	if err != nil {
+		conn.WriteJSON(map[string]string{"event": "error", "error": err.Error()})
+		return
+	}
+
+	if err := client.Connect(); err != nil {
+		conn.WriteJSON(map[string]string{"event": "error", "error": err.Error()})
+		return
+	}
+
+	for evt := range qrChan {
+		switch evt.Event {
+		case "code":
+			conn.WriteJSON(map[string]string{"event": "code", "code": evt.Code})
+		case "success":
+			client.AddEventHandler(func(evt interface{}) {
+				handleEvent(client, p.logger, p.historyCfg, p.dispatcher, evt)
+			})
+			p.registerClient(client)
+			registered = true
+			conn.WriteJSON(map[string]string{"event": "success", "jid": client.Store.ID.String()})
+		default:
+			conn.WriteJSON(map[string]string{"event": evt.Event})
+		}
+	}
+}
+
+// handleLoginPhone pairs a device using a phone number and returns an 8-character pairing code
+// instead of a QR code.
+func (p *ProvisioningAPI) handleLoginPhone(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Phone string `json:"phone"` // E.164, e.g. +14155552671
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Phone == "" {
+		http.Error(w, "phone is required (E.164 format)", http.StatusBadRequest)
+		return
+	}
+
+	device := p.container.NewDevice()
+	client := whatsmeow.NewClient(device, p.logger)
+	if err := client.Connect(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to connect: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	code, err := client.PairPhone(context.Background(), req.Phone, true, whatsmeow.PairClientChrome, "Chrome (Linux)")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to pair phone: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	client.AddEventHandler(func(evt interface{}) {
+		handleEvent(client, p.logger, p.historyCfg, p.dispatcher, evt)
+		if _, ok := evt.(*events.PairSuccess); ok {
+			p.registerClient(client)
+		}
+	})
+
+	json.NewEncoder(w).Encode(map[string]string{"code": code})
+}
+
+// handleLogout logs a device out of WhatsApp. whatsmeow's Logout also deletes the device's stored
+// session; the client itself is not removed from this API's pool.
+func (p *ProvisioningAPI) handleLogout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	client := p.activeClient(r.URL.Query().Get("device_jid"))
+	if client == nil {
+		http.Error(w, "No active session", http.StatusNotFound)
+		return
+	}
+
+	if err := client.Logout(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to logout: %v", err), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// handleStatus reports the connection state of the active (or requested) device.
+func (p *ProvisioningAPI) handleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	client := p.activeClient(r.URL.Query().Get("device_jid"))
+	if client == nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"logged_in": false, "connected": false})
+		return
+	}
+
+	resp := map[string]interface{}{
+		"connected": client.IsConnected(),
+		"logged_in": client.IsLoggedIn(),
+	}
+	if client.Store.ID != nil {
+		jid := client.Store.ID.String()
+		resp["jid"] = jid
+
+		p.mu.Lock()
+		cm := p.connManagers[jid]
+		p.mu.Unlock()
+		if cm != nil {
+			resp["state"] = cm.State()
+		}
+	}
+	if client.Store.PushName != "" {
+		resp["push_name"] = client.Store.PushName
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleSession permanently deletes a stored device: DELETE /api/session?device_jid=...
+func (p *ProvisioningAPI) handleSession(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	client := p.activeClient(r.URL.Query().Get("device_jid"))
+	if client == nil {
+		http.Error(w, "No such session", http.StatusNotFound)
+		return
+	}
+	// Resolve the JID actually backing client before deleting it: the request may have omitted
+	// device_jid, in which case activeClient already resolved it against p.activeJID internally.
+	resolvedJID := client.Store.ID.String()
+
+	client.Disconnect()
+	if err := client.Store.Delete(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to delete session: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	p.mu.Lock()
+	delete(p.clients, resolvedJID)
+	delete(p.connManagers, resolvedJID)
+	if p.activeJID == resolvedJID {
+		p.activeJID = ""
+		for remaining := range p.clients {
+			p.activeJID = remaining
+			break
+		}
+	}
+	p.mu.Unlock()
+
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// ConnectionState is the high-level connection status we expose through /api/status.
+type ConnectionState string
+
+const (
+	StateConnected    ConnectionState = "connected"
+	StateReconnecting ConnectionState = "reconnecting"
+	StateLoggedOut    ConnectionState = "logged_out"
+	StateBanned       ConnectionState = "banned"
+)
+
+const (
+	backoffMin           = 1 * time.Second
+	backoffMax           = 5 * time.Minute
+	backoffFactor        = 2
+	maxKeepAliveFailures = 3
+)
+
+// ConnectionManager watches a client's connection-related events and reconnects it automatically
+// with a jittered exponential backoff, mirroring the jpillora/backoff pattern used elsewhere for
+// bridge reconnects.
+type ConnectionManager struct {
+	client *whatsmeow.Client
+	logger waLog.Logger
+
+	mu                sync.Mutex
+	state             ConnectionState
+	keepAliveFailures int
+	currentBackoff    time.Duration
+	reconnecting      bool
+}
+
+// NewConnectionManager starts watching client's connection events and returns the manager.
+func NewConnectionManager(client *whatsmeow.Client, logger waLog.Logger) *ConnectionManager {
+	cm := &ConnectionManager{
+		client:         client,
+		logger:         logger,
+		state:          StateConnected,
+		currentBackoff: backoffMin,
+	}
+	client.AddEventHandler(cm.handleEvent)
+	return cm
+}
+
+// State returns the manager's current view of the connection.
+func (cm *ConnectionManager) State() ConnectionState {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.state
+}
+
+func (cm *ConnectionManager) handleEvent(evt interface{}) {
+	switch evt.(type) {
+	case *events.Connected:
+		cm.resetBackoff()
+		cm.setState(StateConnected)
+
+	case *events.Disconnected, *events.StreamReplaced, *events.ConnectFailure:
+		cm.setState(StateReconnecting)
+		cm.reconnectWithBackoff()
+
+	case *events.TemporaryBan:
+		cm.setState(StateBanned)
+
+	case *events.LoggedOut:
+		cm.setState(StateLoggedOut)
+
+	case *events.KeepAliveTimeout:
+		cm.mu.Lock()
+		cm.keepAliveFailures++
+		failures := cm.keepAliveFailures
+		if failures >= maxKeepAliveFailures {
+			// Start counting afresh for the connection the forced reconnect below brings up
+			cm.keepAliveFailures = 0
+		}
+		cm.mu.Unlock()
+
+		cm.logger.Warnf("Keepalive timeout (%d consecutive)", failures)
+		if failures >= maxKeepAliveFailures {
+			cm.logger.Warnf("Forcing reconnect after %d consecutive keepalive failures", failures)
+			cm.setState(StateReconnecting)
+			cm.reconnectWithBackoff()
+		}
+
+	case *events.KeepAliveRestored:
+		cm.mu.Lock()
+		cm.keepAliveFailures = 0
+		cm.mu.Unlock()
+	}
+}
+
+// setState updates the tracked state and emits a bridge_state transition log when it actually changes.
+func (cm *ConnectionManager) setState(state ConnectionState) {
+	cm.mu.Lock()
+	changed := cm.state != state
+	cm.state = state
+	cm.mu.Unlock()
+
+	if changed {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"state_event": state,
+			"timestamp":   time.Now().Unix(),
+		})
+		cm.logger.Infof("bridge_state: %s", payload)
+	}
+}
+
+func (cm *ConnectionManager) resetBackoff() {
+	cm.mu.Lock()
+	cm.currentBackoff = backoffMin
+	cm.mu.Unlock()
+}
+
+// reconnectWithBackoff starts the reconnect loop if one isn't already in flight. handleEvent can
+// call this from several disconnect-ish events in quick succession; without the guard each call
+// would spawn its own goroutine racing the others over cm.client and cm.currentBackoff.
+func (cm *ConnectionManager) reconnectWithBackoff() {
+	cm.mu.Lock()
+	if cm.reconnecting {
+		cm.mu.Unlock()
+		return
+	}
+	cm.reconnecting = true
+	cm.mu.Unlock()
+
+	go cm.runReconnectLoop()
+}
+
+// runReconnectLoop retries the connection with a jittered exponential backoff (doubling up to
+// backoffMax) until it succeeds or the device is logged out/banned.
+func (cm *ConnectionManager) runReconnectLoop() {
+	defer func() {
+		cm.mu.Lock()
+		cm.reconnecting = false
+		cm.mu.Unlock()
+	}()
+
+	for {
+		if cm.State() == StateLoggedOut || cm.State() == StateBanned {
+			return
+		}
+
+		cm.mu.Lock()
+		wait := cm.currentBackoff
+		next := cm.currentBackoff * backoffFactor
+		if next > backoffMax {
+			next = backoffMax
+		}
+		cm.currentBackoff = next
+		cm.mu.Unlock()
+
+		sleepFor := wait/2 + time.Duration(rand.Int63n(int64(wait)/2+1))
+		cm.logger.Infof("Reconnecting in %s", sleepFor)
+		time.Sleep(sleepFor)
+
+		if cm.State() == StateLoggedOut || cm.State() == StateBanned {
+			return
+		}
+
+		cm.client.Disconnect()
+		if err := cm.client.Connect(); err != nil {
+			cm.logger.Warnf("Reconnect attempt failed: %v", err)
+			continue
+		}
+		return
+	}
+}
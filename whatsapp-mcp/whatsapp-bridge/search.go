@@ -0,0 +1,343 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// migrateTimestampColumn converts messages.timestamp from a formatted TIMESTAMP string to an
+// INTEGER Unix second count, which is what makes range queries (since/until) index-friendly.
+// It's a no-op once the column is already INTEGER.
+func (store *MessageStore) migrateTimestampColumn() error {
+	rows, err := store.db.Query("PRAGMA table_info(messages)")
+	if err != nil {
+		return err
+	}
+
+	var needsMigration bool
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt interface{}
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		if name == "timestamp" && !strings.EqualFold(colType, "INTEGER") {
+			needsMigration = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	if !needsMigration {
+		return nil
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		CREATE TABLE messages_new (
+			id TEXT,
+			chat_jid TEXT,
+			sender TEXT,
+			content TEXT,
+			timestamp INTEGER,
+			is_from_me BOOLEAN,
+			media_type TEXT,
+			PRIMARY KEY (id, chat_jid),
+			FOREIGN KEY (chat_jid) REFERENCES chats(jid)
+		);
+
+		INSERT INTO messages_new (id, chat_jid, sender, content, timestamp, is_from_me, media_type)
+		SELECT id, chat_jid, sender, content, CAST(strftime('%s', timestamp) AS INTEGER), is_from_me, media_type FROM messages;
+
+		DROP TABLE messages;
+		ALTER TABLE messages_new RENAME TO messages;
+	`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ensureSearchIndex creates the messages_fts virtual table and the triggers that keep it in sync
+// with the messages table, then backfills it once from any rows that predate the index.
+//
+// handleEvent opens a new MessageStore per event, so this runs far more often than "at startup";
+// the anti-join backfill itself is guarded by fts_backfill so it only ever does its full-table
+// scan the first time it sees a given database, not on every ad hoc NewMessageStore() call.
+func (store *MessageStore) ensureSearchIndex() error {
+	_, err := store.db.Exec(`
+		CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+			content,
+			sender,
+			chat_jid UNINDEXED,
+			message_id UNINDEXED
+		);
+
+		CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+			INSERT INTO messages_fts (content, sender, chat_jid, message_id) VALUES (new.content, new.sender, new.chat_jid, new.id);
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+			DELETE FROM messages_fts WHERE chat_jid = old.chat_jid AND message_id = old.id;
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE ON messages BEGIN
+			DELETE FROM messages_fts WHERE chat_jid = old.chat_jid AND message_id = old.id;
+			INSERT INTO messages_fts (content, sender, chat_jid, message_id) VALUES (new.content, new.sender, new.chat_jid, new.id);
+		END;
+
+		CREATE TABLE IF NOT EXISTS fts_backfill (id INTEGER PRIMARY KEY CHECK (id = 1), done BOOLEAN);
+	`)
+	if err != nil {
+		return err
+	}
+
+	var done bool
+	err = store.db.QueryRow("SELECT done FROM fts_backfill WHERE id = 1").Scan(&done)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if done {
+		return nil
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO messages_fts (content, sender, chat_jid, message_id)
+		SELECT m.content, m.sender, m.chat_jid, m.id FROM messages m
+		WHERE NOT EXISTS (
+			SELECT 1 FROM messages_fts f WHERE f.chat_jid = m.chat_jid AND f.message_id = m.id
+		)
+	`); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec("INSERT OR REPLACE INTO fts_backfill (id, done) VALUES (1, TRUE)"); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SearchResult is a single row returned by a message search, including a highlighted snippet.
+type SearchResult struct {
+	ID        string `json:"id"`
+	ChatJID   string `json:"chat_jid"`
+	Sender    string `json:"sender"`
+	Content   string `json:"content"`
+	Snippet   string `json:"snippet"`
+	Timestamp int64  `json:"timestamp"`
+	IsFromMe  bool   `json:"is_from_me"`
+	MediaType string `json:"media_type"`
+}
+
+// SearchMessages runs a full-text (or plain filtered) search over messages, returning up to limit
+// results older than the given cursor (a message rowid used for keyset pagination).
+func (store *MessageStore) SearchMessages(chatJID, query string, since, until int64, fromMe *bool, limit int, cursor int64) ([]SearchResult, error) {
+	var conditions []string
+	var args []interface{}
+
+	query = strings.TrimSpace(query)
+	useFTS := query != ""
+
+	base := "SELECT m.rowid, m.id, m.chat_jid, m.sender, m.content, m.timestamp, m.is_from_me, m.media_type"
+	from := " FROM messages m"
+	if useFTS {
+		base += ", snippet(messages_fts, 0, '[', ']', '...', 10)"
+		from = " FROM messages_fts f JOIN messages m ON m.chat_jid = f.chat_jid AND m.id = f.message_id"
+		conditions = append(conditions, "messages_fts MATCH ?")
+		args = append(args, query)
+	}
+
+	if chatJID != "" {
+		conditions = append(conditions, "m.chat_jid = ?")
+		args = append(args, chatJID)
+	}
+	if since > 0 {
+		conditions = append(conditions, "m.timestamp >= ?")
+		args = append(args, since)
+	}
+	if until > 0 {
+		conditions = append(conditions, "m.timestamp <= ?")
+		args = append(args, until)
+	}
+	if fromMe != nil {
+		conditions = append(conditions, "m.is_from_me = ?")
+		args = append(args, *fromMe)
+	}
+	if cursor > 0 {
+		conditions = append(conditions, "m.rowid < ?")
+		args = append(args, cursor)
+	}
+
+	query2 := base + from
+	if len(conditions) > 0 {
+		query2 += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query2 += " ORDER BY m.rowid DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := store.db.Query(query2, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var rowid int64
+		var r SearchResult
+		var snippet string
+		if useFTS {
+			if err := rows.Scan(&rowid, &r.ID, &r.ChatJID, &r.Sender, &r.Content, &r.Timestamp, &r.IsFromMe, &r.MediaType, &snippet); err != nil {
+				return nil, err
+			}
+			r.Snippet = snippet
+		} else {
+			if err := rows.Scan(&rowid, &r.ID, &r.ChatJID, &r.Sender, &r.Content, &r.Timestamp, &r.IsFromMe, &r.MediaType); err != nil {
+				return nil, err
+			}
+			r.Snippet = r.Content
+		}
+		results = append(results, r)
+	}
+
+	return results, nil
+}
+
+// SearchChats returns chats whose name or last stored message matches query.
+func (store *MessageStore) SearchChats(query string) ([]string, error) {
+	rows, err := store.db.Query(`
+		SELECT DISTINCT c.jid FROM chats c
+		LEFT JOIN messages m ON m.chat_jid = c.jid
+			AND m.rowid = (SELECT m2.rowid FROM messages m2 WHERE m2.chat_jid = c.jid ORDER BY m2.timestamp DESC LIMIT 1)
+		WHERE c.name LIKE ? OR m.content LIKE ?
+		ORDER BY c.last_message_time DESC
+	`, "%"+query+"%", "%"+query+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jids []string
+	for rows.Next() {
+		var jid string
+		if err := rows.Scan(&jid); err != nil {
+			return nil, err
+		}
+		jids = append(jids, jid)
+	}
+	return jids, nil
+}
+
+// GetMessageByID fetches a single message along with its attachment metadata, if any.
+func (store *MessageStore) GetMessageByID(chatJID, messageID string) (*SearchResult, *Attachment, error) {
+	var r SearchResult
+	err := store.db.QueryRow(
+		"SELECT id, chat_jid, sender, content, timestamp, is_from_me, media_type FROM messages WHERE chat_jid = ? AND id = ?",
+		chatJID, messageID,
+	).Scan(&r.ID, &r.ChatJID, &r.Sender, &r.Content, &r.Timestamp, &r.IsFromMe, &r.MediaType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	att, err := store.GetAttachment(chatJID, messageID)
+	if err != nil {
+		att = nil
+	}
+
+	return &r, att, nil
+}
+
+// registerSearchHandlers wires up the search/browse endpoints onto the default mux.
+func registerSearchHandlers(messageStore *MessageStore) {
+	http.HandleFunc("/api/messages", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		q := r.URL.Query()
+		limit := 50
+		if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 {
+			limit = v
+		}
+		var cursor int64
+		if v, err := strconv.ParseInt(q.Get("cursor"), 10, 64); err == nil {
+			cursor = v
+		}
+		var since, until int64
+		if v, err := strconv.ParseInt(q.Get("since"), 10, 64); err == nil {
+			since = v
+		}
+		if v, err := strconv.ParseInt(q.Get("until"), 10, 64); err == nil {
+			until = v
+		}
+		var fromMe *bool
+		if v := q.Get("from_me"); v != "" {
+			b := v == "1" || v == "true"
+			fromMe = &b
+		}
+
+		results, err := messageStore.SearchMessages(q.Get("chat"), q.Get("q"), since, until, fromMe, limit, cursor)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": err.Error()})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "results": results})
+	})
+
+	http.HandleFunc("/api/chats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		q := r.URL.Query().Get("q")
+		if q == "" {
+			http.Error(w, "q query parameter is required", http.StatusBadRequest)
+			return
+		}
+
+		jids, err := messageStore.SearchChats(q)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "chats": jids})
+	})
+
+	http.HandleFunc("/api/messages/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		chatJID := r.URL.Query().Get("chat")
+		messageID := strings.TrimPrefix(r.URL.Path, "/api/messages/")
+		if chatJID == "" || messageID == "" {
+			http.Error(w, "chat and a message id are required", http.StatusBadRequest)
+			return
+		}
+
+		msg, att, err := messageStore.GetMessageByID(chatJID, messageID)
+		if err != nil {
+			http.Error(w, "Message not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": msg, "attachment": att})
+	})
+}
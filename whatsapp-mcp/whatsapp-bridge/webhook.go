@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// WebhookConfig configures the outbound webhook dispatcher.
+type WebhookConfig struct {
+	URL            string
+	Secret         string
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// loadWebhookConfig builds a WebhookConfig from the environment. An empty URL disables dispatch.
+func loadWebhookConfig() WebhookConfig {
+	return WebhookConfig{
+		URL:            os.Getenv("WEBHOOK_URL"),
+		Secret:         os.Getenv("WEBHOOK_SECRET"),
+		MaxRetries:     10,
+		InitialBackoff: 1 * time.Second,
+		MaxBackoff:     5 * time.Minute,
+	}
+}
+
+// WebhookOutboxRow is a single queued-for-retry webhook delivery.
+type WebhookOutboxRow struct {
+	ID        int64
+	EventType string
+	Payload   string
+	Attempts  int
+}
+
+// StoreWebhookEvent persists an event to the outbox so it survives a restart until delivered.
+func (store *MessageStore) StoreWebhookEvent(eventType string, payload []byte) (int64, error) {
+	now := time.Now().Unix()
+	res, err := store.db.Exec(
+		"INSERT INTO webhook_outbox (event_type, payload, attempts, created_at, next_attempt_at) VALUES (?, ?, 0, ?, ?)",
+		eventType, string(payload), now, now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// DeleteWebhookEvent removes an acked (or abandoned) event from the outbox.
+func (store *MessageStore) DeleteWebhookEvent(id int64) error {
+	_, err := store.db.Exec("DELETE FROM webhook_outbox WHERE id = ?", id)
+	return err
+}
+
+// BumpWebhookAttempt records a failed delivery attempt and schedules the next retry.
+func (store *MessageStore) BumpWebhookAttempt(id int64, nextAttemptAt time.Time) error {
+	_, err := store.db.Exec(
+		"UPDATE webhook_outbox SET attempts = attempts + 1, next_attempt_at = ? WHERE id = ?",
+		nextAttemptAt.Unix(), id,
+	)
+	return err
+}
+
+// PendingWebhookEvents returns outbox rows due for (re)delivery.
+func (store *MessageStore) PendingWebhookEvents() ([]WebhookOutboxRow, error) {
+	rows, err := store.db.Query(
+		"SELECT id, event_type, payload, attempts FROM webhook_outbox WHERE next_attempt_at <= ? ORDER BY id ASC",
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []WebhookOutboxRow
+	for rows.Next() {
+		var row WebhookOutboxRow
+		if err := rows.Scan(&row.ID, &row.EventType, &row.Payload, &row.Attempts); err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	return result, nil
+}
+
+// WebhookDispatcher posts structured events to cfg.URL, signing each payload with HMAC-SHA256 and
+// persisting anything that isn't acked with a 2xx so it can be retried with backoff later.
+type WebhookDispatcher struct {
+	cfg          WebhookConfig
+	messageStore *MessageStore
+	logger       waLog.Logger
+	httpClient   *http.Client
+}
+
+// NewWebhookDispatcher creates a dispatcher. Dispatch is a no-op when cfg.URL is empty.
+func NewWebhookDispatcher(cfg WebhookConfig, messageStore *MessageStore, logger waLog.Logger) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		cfg:          cfg,
+		messageStore: messageStore,
+		logger:       logger,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Dispatch signs and POSTs payload for eventType. The actual send happens off the caller's
+// goroutine since Dispatch is invoked directly from whatsmeow's event-handler callback, which
+// must not block on network I/O; on failure the event is queued in the outbox for StartRetryLoop
+// to retry later.
+func (d *WebhookDispatcher) Dispatch(eventType string, payload interface{}) {
+	if d.cfg.URL == "" {
+		return
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"type": eventType,
+		"data": payload,
+		"time": time.Now().Unix(),
+	})
+	if err != nil {
+		d.logger.Warnf("Failed to marshal webhook payload for %s: %v", eventType, err)
+		return
+	}
+
+	go d.dispatchAsync(eventType, body)
+}
+
+// dispatchAsync sends body and, on failure, persists it to the outbox for later retry.
+func (d *WebhookDispatcher) dispatchAsync(eventType string, body []byte) {
+	if err := d.send(body); err != nil {
+		d.logger.Warnf("Webhook delivery failed for %s, queuing for retry: %v", eventType, err)
+		if _, stErr := d.messageStore.StoreWebhookEvent(eventType, body); stErr != nil {
+			d.logger.Warnf("Failed to persist undelivered webhook event: %v", stErr)
+		}
+	}
+}
+
+// send POSTs body to the configured URL with an HMAC-SHA256 signature header, returning an error
+// unless the endpoint acks with a 2xx.
+func (d *WebhookDispatcher) send(body []byte) error {
+	mac := hmac.New(sha256.New, []byte(d.cfg.Secret))
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	req, err := http.NewRequest(http.MethodPost, d.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Signature", "sha256="+signature)
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// StartRetryLoop periodically retries everything due in the outbox, backing off exponentially per
+// event up to cfg.MaxRetries attempts, after which the event is dropped.
+func (d *WebhookDispatcher) StartRetryLoop() {
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			pending, err := d.messageStore.PendingWebhookEvents()
+			if err != nil {
+				d.logger.Warnf("Failed to load pending webhook events: %v", err)
+				continue
+			}
+
+			for _, row := range pending {
+				if err := d.send([]byte(row.Payload)); err != nil {
+					if row.Attempts+1 >= d.cfg.MaxRetries {
+						d.logger.Warnf("Dropping webhook event %d (%s) after %d attempts: %v", row.ID, row.EventType, row.Attempts+1, err)
+						d.messageStore.DeleteWebhookEvent(row.ID)
+						continue
+					}
+
+					backoff := d.cfg.InitialBackoff * time.Duration(int64(1)<<uint(row.Attempts))
+					if backoff > d.cfg.MaxBackoff {
+						backoff = d.cfg.MaxBackoff
+					}
+					d.messageStore.BumpWebhookAttempt(row.ID, time.Now().Add(backoff))
+					continue
+				}
+
+				d.messageStore.DeleteWebhookEvent(row.ID)
+			}
+		}
+	}()
+}